@@ -35,12 +35,13 @@ Build behavior:
     When LGTM_SRC is not set, the script installs dependencies as described below, and then invokes the
     extractor in the working directory.
 
-    If LGTM_SRC is set, it checks for the presence of the files 'go.mod', 'Gopkg.toml', and
-    'glide.yaml' to determine how to install dependencies: if a 'Gopkg.toml' file is present, it uses
-    'dep ensure', if there is a 'glide.yaml' it uses 'glide install', and otherwise 'go get'.
-    Additionally, unless a 'go.mod' file is detected, it sets up a temporary GOPATH and moves all
-    source files into a folder corresponding to the package's import path before installing
-    dependencies.
+    If LGTM_SRC is set, it checks for the presence of the files 'go.work', 'go.mod', 'Gopkg.toml',
+    and 'glide.yaml' to determine how to install dependencies: if a 'go.work' file is present, it
+    runs 'go work sync' and extracts every module listed by its 'use' directives together; if a
+    'Gopkg.toml' file is present, it uses 'dep ensure', if there is a 'glide.yaml' it uses
+    'glide install', and otherwise 'go get'. Additionally, unless a 'go.work' or 'go.mod' file is
+    detected, it sets up a temporary GOPATH and moves all source files into a folder corresponding
+    to the package's import path before installing dependencies.
 
     This behavior can be further customized using environment variables: setting LGTM_INDEX_NEED_GOPATH
     to 'false' disables the GOPATH set-up, CODEQL_EXTRACTOR_GO_BUILD_COMMAND (or alternatively
@@ -169,6 +170,9 @@ const (
 	GoGetNoModules DependencyInstallerMode = iota
 	// GoGetWithModules represents dependency installation using `go get` with modules
 	GoGetWithModules
+	// GoWorkspace represents dependency installation in a Go 1.18+ workspace, i.e. when a
+	// `go.work` file is present and has not been disabled with `GOWORK=off`
+	GoWorkspace
 	// Dep represent dependency installation using `dep ensure`
 	Dep
 	// Glide represents dependency installation using `glide install`
@@ -244,6 +248,10 @@ func getSourceDir() string {
 
 // Returns the appropriate DependencyInstallerMode for the current project
 func getDepMode() DependencyInstallerMode {
+	if _, found := tryReadGoWork(); found {
+		log.Println("Found go.work, enabling workspace mode")
+		return GoWorkspace
+	}
 	if util.FileExists("go.mod") {
 		log.Println("Found go.mod, enabling go modules")
 		return GoGetWithModules
@@ -260,14 +268,21 @@ func getDepMode() DependencyInstallerMode {
 }
 
 // Tries to open `go.mod` and read a go directive, returning the version and whether it was found.
+// In workspace mode, the `go.work` file and every workspace module's `go.mod` are consulted
+// instead, and the highest version found amongst them is returned.
 func tryReadGoDirective(depMode DependencyInstallerMode) (string, bool) {
+	if depMode == GoWorkspace {
+		if w, found := tryReadGoWork(); found {
+			return w.effectiveGoVersion()
+		}
+		return "", false
+	}
 	if depMode == GoGetWithModules {
-		versionRe := regexp.MustCompile(`(?m)^go[ \t\r]+([0-9]+\.[0-9]+)$`)
 		goMod, err := os.ReadFile("go.mod")
 		if err != nil {
 			log.Println("Failed to read go.mod to check for missing Go version")
 		} else {
-			matches := versionRe.FindSubmatch(goMod)
+			matches := goDirectiveRe.FindSubmatch(goMod)
 			if matches != nil {
 				if len(matches) > 1 {
 					return string(matches[1]), true
@@ -280,6 +295,11 @@ func tryReadGoDirective(depMode DependencyInstallerMode) (string, bool) {
 
 // Returns the appropriate ModMode for the current project
 func getModMode(depMode DependencyInstallerMode) ModMode {
+	if depMode == GoWorkspace {
+		// `go` rejects `-mod=vendor` when a workspace is active, since workspaces have no
+		// single vendor directory to satisfy it from
+		return ModReadonly
+	}
 	if depMode == GoGetWithModules {
 		// if a vendor/modules.txt file exists, we assume that there are vendored Go dependencies, and
 		// skip the dependency installation step and run the extractor with `-mod=vendor`
@@ -325,7 +345,7 @@ func fixGoVendorIssues(modMode ModMode, depMode DependencyInstallerMode, goModVe
 // Determines whether the project needs a GOPATH set up
 func getNeedGopath(depMode DependencyInstallerMode, importpath string) bool {
 	needGopath := true
-	if depMode == GoGetWithModules {
+	if depMode == GoGetWithModules || depMode == GoWorkspace {
 		needGopath = false
 	}
 	// if `LGTM_INDEX_NEED_GOPATH` is set, it overrides the value for `needGopath` inferred above
@@ -347,6 +367,15 @@ func getNeedGopath(depMode DependencyInstallerMode, importpath string) bool {
 
 // Try to update `go.mod` and `go.sum` if the go version is >= 1.16.
 func tryUpdateGoModAndGoSum(modMode ModMode, depMode DependencyInstallerMode) {
+	// in workspace mode there is no single go.mod/go.sum to tidy; instead reconcile the
+	// workspace's modules with `go work sync`
+	if depMode == GoWorkspace {
+		if !syncWorkspace() {
+			log.Println("Failed to run `go work sync`")
+		}
+		return
+	}
+
 	// Go 1.16 and later won't automatically attempt to update go.mod / go.sum during package loading, so try to update them here:
 	if modMode != ModVendor && depMode == GoGetWithModules && semver.Compare(getEnvGoSemVer(), "v1.16") >= 0 {
 		// stat go.mod and go.sum
@@ -519,7 +548,7 @@ func buildWithoutCustomCommands(modMode ModMode) bool {
 		log.Println("Build failed, continuing to install dependencies.")
 
 		shouldInstallDependencies = true
-	} else if util.DepErrors("./...", modMode.argsForGoVersion(getEnvGoSemVer())...) {
+	} else if util.DepErrors("./...", append(modMode.argsForGoVersion(getEnvGoSemVer()), overlayArgs()...)...) {
 		log.Println("Dependencies are still not resolving after the build, continuing to install dependencies.")
 
 		shouldInstallDependencies = true
@@ -598,6 +627,11 @@ func installDependencies(depMode DependencyInstallerMode) {
 	} else if depMode == Glide {
 		install = exec.Command("glide", "install")
 		log.Println("Installing dependencies using `glide install`")
+	} else if depMode == GoWorkspace {
+		// dependencies across the workspace were already reconciled with `go work sync` in
+		// tryUpdateGoModAndGoSum; there is no per-module `go get` to run on top of that
+		log.Println("Workspace dependencies were already reconciled with `go work sync`; skipping `go get`.")
+		return
 	} else {
 		// explicitly set go module support
 		if depMode == GoGetWithModules {
@@ -626,10 +660,17 @@ func extract(depMode DependencyInstallerMode, modMode ModMode) {
 	}
 
 	extractorArgs := []string{}
-	if depMode == GoGetWithModules {
+	if depMode == GoGetWithModules || depMode == GoWorkspace {
 		extractorArgs = append(extractorArgs, modMode.argsForGoVersion(getEnvGoSemVer())...)
 	}
-	extractorArgs = append(extractorArgs, "./...")
+	extractorArgs = append(extractorArgs, overlayArgs()...)
+	if depMode == GoWorkspace {
+		// `./...` alone only reaches packages nested under the workspace root; pass every
+		// `use`d module explicitly so sibling modules are extracted too
+		extractorArgs = append(extractorArgs, workspaceExtractPatterns()...)
+	} else {
+		extractorArgs = append(extractorArgs, "./...")
+	}
 
 	log.Printf("Running extractor command '%s %v' from directory '%s'.\n", extractor, extractorArgs, cwd)
 	cmd := exec.Command(extractor, extractorArgs...)
@@ -647,9 +688,6 @@ func installDependenciesAndBuild() {
 
 	srcdir := getSourceDir()
 
-	// we set `SEMMLE_PATH_TRANSFORMER` ourselves in some cases, so blank it out first for consistency
-	os.Setenv("SEMMLE_PATH_TRANSFORMER", "")
-
 	// determine how to install dependencies and whether a GOPATH needs to be set up before
 	// extraction
 	depMode := getDepMode()
@@ -657,6 +695,26 @@ func installDependenciesAndBuild() {
 		os.Setenv("GO111MODULE", "auto")
 	}
 
+	// if a `toolchain` directive pins a newer Go than what's on PATH, provision it and re-exec
+	// under it before doing anything else. This has to happen before we acquire the source lock
+	// below: ensureToolchain re-execs this very binary with the same arguments, so the child
+	// process runs installDependenciesAndBuild again and would deadlock trying to acquire a lock
+	// its own parent is still holding while blocked waiting for the child to exit.
+	ensureToolchain(depMode)
+
+	// serialize concurrent autobuilder invocations against the same checkout, so the
+	// moveToTemporaryGopath/tryUpdateGoModAndGoSum/restoreRepoLayout dance can't race
+	srcLock := acquireSourceLock(srcdir)
+	defer srcLock.release()
+
+	// we set `SEMMLE_PATH_TRANSFORMER` ourselves in some cases, so blank it out first for consistency
+	os.Setenv("SEMMLE_PATH_TRANSFORMER", "")
+
+	if depMode == GoGetWithModules || depMode == GoWorkspace {
+		configureModuleCache()
+		configureGoProxy()
+	}
+
 	goModVersion, goModVersionFound := tryReadGoDirective(depMode)
 
 	if semver.Compare("v"+goModVersion, getEnvGoSemVer()) >= 0 {
@@ -713,33 +771,40 @@ func installDependenciesAndBuild() {
 		}
 	}
 
+	// if CODEQL_EXTRACTOR_GO_OVERLAY names an overlay file, make sure any virtual paths it
+	// introduces are mapped back to their logical originals before extracting
+	configurePathTransformerForOverlay()
+
 	extract(depMode, modMode)
 }
 
 const minGoVersion = "1.11"
-const maxGoVersion = "1.20"
 
-// Check if `version` is lower than `minGoVersion` or higher than `maxGoVersion`. Note that for
+// Check if `version` is lower than `minGoVersion` or higher than `maxVersion`. Note that for
 // this comparison we ignore the patch part of the version, so 1.20.1 and 1.20 are considered
 // equal.
-func outsideSupportedRange(version string) bool {
+func outsideSupportedRange(version, maxVersion string) bool {
 	short := semver.MajorMinor("v" + version)
-	return semver.Compare(short, "v"+minGoVersion) < 0 || semver.Compare(short, "v"+maxGoVersion) > 0
+	return semver.Compare(short, "v"+minGoVersion) < 0 || semver.Compare(short, "v"+maxVersion) > 0
 }
 
-// Check if `v.goModVersion` or `v.goEnvVersion` are outside of the supported range. If so, emit
-// a diagnostic and return an empty version to indicate that we should not attempt to install a
-// different version of Go.
-func checkForUnsupportedVersions(v versionInfo) (msg, version string) {
-	if v.goModVersionFound && outsideSupportedRange(v.goModVersion) {
-		msg = "The version of Go found in the `go.mod` file (" + v.goModVersion +
-			") is outside of the supported range (" + minGoVersion + "-" + maxGoVersion +
+// Check if `v.requiredVersion()` or `v.goEnvVersion` are outside of the supported range. If so,
+// emit a diagnostic and return an empty version to indicate that we should not attempt to install
+// a different version of Go.
+func checkForUnsupportedVersions(v versionInfo, maxVersion string) (msg, version string) {
+	if required, found := v.requiredVersion(); found && outsideSupportedRange(required, maxVersion) {
+		what := "go.mod"
+		if v.toolchainVersionFound {
+			what = "toolchain"
+		}
+		msg = "The version of Go found in the `" + what + "` directive (" + required +
+			") is outside of the supported range (" + minGoVersion + "-" + maxVersion +
 			"). Writing an environment file not specifying any version of Go."
 		version = ""
 		diagnostics.EmitUnsupportedVersionGoMod(msg)
-	} else if v.goEnvVersionFound && outsideSupportedRange(v.goEnvVersion) {
+	} else if v.goEnvVersionFound && outsideSupportedRange(v.goEnvVersion, maxVersion) {
 		msg = "The version of Go installed in the environment (" + v.goEnvVersion +
-			") is outside of the supported range (" + minGoVersion + "-" + maxGoVersion +
+			") is outside of the supported range (" + minGoVersion + "-" + maxVersion +
 			"). Writing an environment file not specifying any version of Go."
 		version = ""
 		diagnostics.EmitUnsupportedVersionEnvironment(msg)
@@ -748,26 +813,28 @@ func checkForUnsupportedVersions(v versionInfo) (msg, version string) {
 	return msg, version
 }
 
-// Check if either `v.goEnvVersionFound` or `v.goModVersionFound` are false. If so, emit
+// Check if either `v.goEnvVersionFound` or `v.requiredVersion()` are false. If so, emit
 // a diagnostic and return the version to install, or the empty string if we should not attempt to
 // install a version of Go. We assume that `checkForUnsupportedVersions` has already been
 // called, so any versions that are found are within the supported range.
-func checkForVersionsNotFound(v versionInfo) (msg, version string) {
-	if !v.goEnvVersionFound && !v.goModVersionFound {
+func checkForVersionsNotFound(v versionInfo, maxVersion string) (msg, version string) {
+	required, requiredFound := v.requiredVersion()
+
+	if !v.goEnvVersionFound && !requiredFound {
 		msg = "No version of Go installed and no `go.mod` file found. Writing an environment " +
-			"file specifying the maximum supported version of Go (" + maxGoVersion + ")."
-		version = maxGoVersion
+			"file specifying the maximum supported version of Go (" + maxVersion + ")."
+		version = maxVersion
 		diagnostics.EmitNoGoModAndNoGoEnv(msg)
 	}
 
-	if !v.goEnvVersionFound && v.goModVersionFound {
+	if !v.goEnvVersionFound && requiredFound {
 		msg = "No version of Go installed. Writing an environment file specifying the version " +
-			"of Go found in the `go.mod` file (" + v.goModVersion + ")."
-		version = v.goModVersion
+			"of Go required (" + required + ")."
+		version = required
 		diagnostics.EmitNoGoEnv(msg)
 	}
 
-	if v.goEnvVersionFound && !v.goModVersionFound {
+	if v.goEnvVersionFound && !requiredFound {
 		msg = "No `go.mod` file found. Version " + v.goEnvVersion + " installed in the " +
 			"environment. Writing an environment file not specifying any version of Go."
 		version = ""
@@ -777,21 +844,31 @@ func checkForVersionsNotFound(v versionInfo) (msg, version string) {
 	return msg, version
 }
 
-// Compare `v.goModVersion` and `v.goEnvVersion`. emit a diagnostic and return the version to
-// install, or the empty string if we should not attempt to install a version of Go. We assume that
+// Compare the required version of Go - the `toolchain` directive if one was found, otherwise the
+// `go` directive - against `v.goEnvVersion`. Emit a diagnostic and return the version to install,
+// or the empty string if we should not attempt to install a version of Go. We assume that
 // `checkForUnsupportedVersions` and `checkForVersionsNotFound` have already been called, so both
 // versions are found and are within the supported range.
 func compareVersions(v versionInfo) (msg, version string) {
-	if semver.Compare("v"+v.goModVersion, "v"+v.goEnvVersion) > 0 {
+	required, _ := v.requiredVersion()
+	what := "go.mod"
+	if v.toolchainVersionFound {
+		what = "toolchain"
+	}
+
+	if semver.Compare("v"+required, "v"+v.goEnvVersion) > 0 {
 		msg = "The version of Go installed in the environment (" + v.goEnvVersion +
-			") is lower than the version found in the `go.mod` file (" + v.goModVersion +
-			"). Writing an environment file specifying the version of Go from the `go.mod` " +
-			"file (" + v.goModVersion + ")."
-		version = v.goModVersion
-		diagnostics.EmitVersionGoModHigherVersionEnvironment(msg)
+			") is lower than the version required by the `" + what + "` directive (" + required +
+			"). Writing an environment file specifying the required version of Go (" + required + ")."
+		version = required
+		if v.toolchainVersionFound {
+			diagnostics.EmitVersionToolchainHigherVersionEnvironment(msg)
+		} else {
+			diagnostics.EmitVersionGoModHigherVersionEnvironment(msg)
+		}
 	} else {
 		msg = "The version of Go installed in the environment (" + v.goEnvVersion +
-			") is high enough for the version found in the `go.mod` file (" + v.goModVersion +
+			") is high enough for the version required by the `" + what + "` directive (" + required +
 			"). Writing an environment file not specifying any version of Go."
 		version = ""
 		diagnostics.EmitVersionGoModNotHigherVersionEnvironment(msg)
@@ -803,12 +880,14 @@ func compareVersions(v versionInfo) (msg, version string) {
 // Check the versions of Go found in the environment and in the `go.mod` file, and return a
 // version to install. If the version is the empty string then no installation is required.
 func getVersionToInstall(v versionInfo) (msg, version string) {
-	msg, version = checkForUnsupportedVersions(v)
+	maxVersion := resolveMaxGoVersion()
+
+	msg, version = checkForUnsupportedVersions(v, maxVersion)
 	if msg != "" {
 		return msg, version
 	}
 
-	msg, version = checkForVersionsNotFound(v)
+	msg, version = checkForVersionsNotFound(v, maxVersion)
 	if msg != "" {
 		return msg, version
 	}
@@ -855,16 +934,28 @@ func writeEnvironmentFile(version string) {
 }
 
 type versionInfo struct {
-	goModVersion      string // The version of Go found in the go directive in the `go.mod` file.
-	goModVersionFound bool   // Whether a `go` directive was found in the `go.mod` file.
-	goEnvVersion      string // The version of Go found in the environment.
-	goEnvVersionFound bool   // Whether an installation of Go was found in the environment.
+	goModVersion          string // The version of Go found in the go directive in the `go.mod` file.
+	goModVersionFound     bool   // Whether a `go` directive was found in the `go.mod` file.
+	toolchainVersion      string // The version of Go pinned by a `toolchain` directive, if any.
+	toolchainVersionFound bool   // Whether a `toolchain` directive was found.
+	goEnvVersion          string // The version of Go found in the environment.
+	goEnvVersionFound     bool   // Whether an installation of Go was found in the environment.
+}
+
+// requiredVersion returns the version of Go that the project requires: the `toolchain` directive
+// if one was found, since that's the version the `go` command itself would switch to, or
+// otherwise the `go` directive.
+func (v versionInfo) requiredVersion() (string, bool) {
+	if v.toolchainVersionFound {
+		return v.toolchainVersion, true
+	}
+	return v.goModVersion, v.goModVersionFound
 }
 
 func (v versionInfo) String() string {
 	return fmt.Sprintf(
-		"go.mod version: %s, go.mod directive found: %t, go env version: %s, go installation found: %t",
-		v.goModVersion, v.goModVersionFound, v.goEnvVersion, v.goEnvVersionFound)
+		"go.mod version: %s, go.mod directive found: %t, toolchain version: %s, toolchain directive found: %t, go env version: %s, go installation found: %t",
+		v.goModVersion, v.goModVersionFound, v.toolchainVersion, v.toolchainVersionFound, v.goEnvVersion, v.goEnvVersionFound)
 }
 
 // Check if Go is installed in the environment.
@@ -878,6 +969,7 @@ func identifyEnvironment() {
 	var v versionInfo
 	depMode := getDepMode()
 	v.goModVersion, v.goModVersionFound = tryReadGoDirective(depMode)
+	v.toolchainVersion, v.toolchainVersionFound = tryReadToolchainDirective(depMode)
 
 	v.goEnvVersionFound = isGoInstalled()
 	if v.goEnvVersionFound {
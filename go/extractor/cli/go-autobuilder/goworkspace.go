@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/github/codeql-go/extractor/util"
+)
+
+// goWorkspace describes a Go workspace as declared by a `go.work` file: its own `go` directive,
+// if any, and the directories listed by its `use` directives.
+type goWorkspace struct {
+	goVersion string
+	modules   []string
+}
+
+// goWorkUseLineRe matches a single-line `use ./foo` directive.
+var goWorkUseLineRe = regexp.MustCompile(`(?m)^use[ \t]+(\S+)[ \t\r]*$`)
+
+// goWorkUseBlockRe matches a parenthesized `use (\n\t./foo\n\t./bar\n)` block.
+var goWorkUseBlockRe = regexp.MustCompile(`(?ms)^use[ \t]*\(\s*(.*?)\s*\)`)
+
+// goDirectiveRe matches a `go 1.21` directive line, shared between go.mod and go.work files.
+var goDirectiveRe = regexp.MustCompile(`(?m)^go[ \t\r]+([0-9]+\.[0-9]+)$`)
+
+// isGoWorkDisabled returns true if the user has opted out of workspace mode via `GOWORK=off`,
+// which is the same escape hatch the `go` command itself honors.
+func isGoWorkDisabled() bool {
+	return os.Getenv("GOWORK") == "off"
+}
+
+// tryReadGoWork attempts to parse a `go.work` file in the current directory, returning the
+// workspace it describes and whether one was found. No workspace is reported if `go.work` does
+// not exist, cannot be read, lists no `use` directives, or `GOWORK=off` has been set.
+func tryReadGoWork() (goWorkspace, bool) {
+	if isGoWorkDisabled() {
+		return goWorkspace{}, false
+	}
+	if !util.FileExists("go.work") {
+		return goWorkspace{}, false
+	}
+
+	data, err := os.ReadFile("go.work")
+	if err != nil {
+		log.Println("Failed to read go.work to check for workspace modules")
+		return goWorkspace{}, false
+	}
+
+	var w goWorkspace
+	if matches := goDirectiveRe.FindSubmatch(data); matches != nil {
+		w.goVersion = string(matches[1])
+	}
+
+	for _, m := range goWorkUseLineRe.FindAllSubmatch(data, -1) {
+		// a line opening a parenthesized `use (` block also matches this regex, with "(" as the
+		// captured token; that's handled by goWorkUseBlockRe below instead.
+		if module := string(m[1]); module != "(" {
+			w.modules = append(w.modules, module)
+		}
+	}
+	if m := goWorkUseBlockRe.FindSubmatch(data); m != nil {
+		for _, line := range strings.Split(string(m[1]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "//") {
+				continue
+			}
+			w.modules = append(w.modules, strings.Fields(line)[0])
+		}
+	}
+
+	if len(w.modules) == 0 {
+		return goWorkspace{}, false
+	}
+	return w, true
+}
+
+// effectiveGoVersion returns the highest `go` directive amongst the workspace's own `go.work`
+// and the `go.mod` of every module it uses, and whether any version was found at all.
+func (w goWorkspace) effectiveGoVersion() (string, bool) {
+	best := w.goVersion
+	found := best != ""
+
+	for _, modDir := range w.modules {
+		data, err := os.ReadFile(filepath.Join(modDir, "go.mod"))
+		if err != nil {
+			log.Printf("Failed to read go.mod for workspace module %s\n", modDir)
+			continue
+		}
+		matches := goDirectiveRe.FindSubmatch(data)
+		if matches == nil {
+			continue
+		}
+		version := string(matches[1])
+		if !found || semver.Compare("v"+version, "v"+best) > 0 {
+			best = version
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// syncWorkspace reconciles a workspace's dependencies with `go work sync`, the workspace
+// equivalent of `go mod tidy -e`.
+func syncWorkspace() bool {
+	log.Println("Reconciling workspace dependencies using `go work sync`.")
+	return util.RunCmd(exec.Command("go", "work", "sync"))
+}
+
+// workspaceExtractPatterns returns one `<dir>/...` build pattern per module declared by the
+// workspace's `use` directives, so that packages living in every module of the workspace are
+// actually built and extracted, rather than only those reachable from the workspace root via a
+// single `./...` pattern.
+func workspaceExtractPatterns() []string {
+	w, found := tryReadGoWork()
+	if !found {
+		return nil
+	}
+
+	patterns := make([]string, 0, len(w.modules))
+	for _, modDir := range w.modules {
+		pattern := strings.TrimSuffix(modDir, "/")
+		patterns = append(patterns, pattern+"/...")
+	}
+	return patterns
+}
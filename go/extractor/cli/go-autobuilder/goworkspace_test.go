@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withWorkdir changes into a fresh temporary directory for the duration of the test, restoring
+// the previous working directory afterwards.
+func withWorkdir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	prev, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir: %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(prev) })
+	return dir
+}
+
+func TestTryReadGoWork(t *testing.T) {
+	tests := []struct {
+		name        string
+		goWork      string
+		gowork      string // GOWORK environment variable
+		wantFound   bool
+		wantVersion string
+		wantModules []string
+	}{
+		{
+			name:      "no go.work file",
+			wantFound: false,
+		},
+		{
+			name:      "GOWORK=off disables workspace mode",
+			goWork:    "go 1.21\nuse ./foo\n",
+			gowork:    "off",
+			wantFound: false,
+		},
+		{
+			name:        "single-line use directives",
+			goWork:      "go 1.21\n\nuse ./foo\nuse ./bar\n",
+			wantFound:   true,
+			wantVersion: "1.21",
+			wantModules: []string{"./foo", "./bar"},
+		},
+		{
+			name:        "parenthesized use block",
+			goWork:      "go 1.22\n\nuse (\n\t./foo\n\t./bar\n)\n",
+			wantFound:   true,
+			wantVersion: "1.22",
+			wantModules: []string{"./foo", "./bar"},
+		},
+		{
+			name:        "use block with a comment line",
+			goWork:      "go 1.22\n\nuse (\n\t./foo\n\t// ./ignored\n\t./bar\n)\n",
+			wantFound:   true,
+			wantVersion: "1.22",
+			wantModules: []string{"./foo", "./bar"},
+		},
+		{
+			name:        "no go directive is reported as an empty version, not a parse failure",
+			goWork:      "use ./foo\n",
+			wantFound:   true,
+			wantModules: []string{"./foo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withWorkdir(t)
+			if tt.gowork != "" {
+				t.Setenv("GOWORK", tt.gowork)
+			}
+			if tt.goWork != "" {
+				if err := os.WriteFile("go.work", []byte(tt.goWork), 0644); err != nil {
+					t.Fatalf("WriteFile: %s", err)
+				}
+			}
+
+			w, found := tryReadGoWork()
+			if found != tt.wantFound {
+				t.Fatalf("tryReadGoWork() found = %v, want %v", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			if w.goVersion != tt.wantVersion {
+				t.Errorf("goVersion = %q, want %q", w.goVersion, tt.wantVersion)
+			}
+			if !equalStrings(w.modules, tt.wantModules) {
+				t.Errorf("modules = %v, want %v", w.modules, tt.wantModules)
+			}
+		})
+	}
+}
+
+func TestGoWorkspaceEffectiveGoVersion(t *testing.T) {
+	withWorkdir(t)
+
+	mustMkModule(t, "foo", "go 1.19\n")
+	mustMkModule(t, "bar", "go 1.21\n")
+	mustMkModule(t, "baz", "not a go.mod at all")
+
+	w := goWorkspace{goVersion: "1.18", modules: []string{"foo", "bar", "baz", "missing"}}
+
+	version, found := w.effectiveGoVersion()
+	if !found {
+		t.Fatal("effectiveGoVersion() found = false, want true")
+	}
+	if version != "1.21" {
+		t.Errorf("effectiveGoVersion() = %q, want %q", version, "1.21")
+	}
+}
+
+func TestGoWorkspaceEffectiveGoVersionNoneFound(t *testing.T) {
+	withWorkdir(t)
+
+	w := goWorkspace{modules: []string{"missing"}}
+	if _, found := w.effectiveGoVersion(); found {
+		t.Error("effectiveGoVersion() found = true, want false")
+	}
+}
+
+func TestWorkspaceExtractPatterns(t *testing.T) {
+	withWorkdir(t)
+
+	if patterns := workspaceExtractPatterns(); patterns != nil {
+		t.Errorf("workspaceExtractPatterns() with no go.work = %v, want nil", patterns)
+	}
+
+	if err := os.WriteFile("go.work", []byte("go 1.21\n\nuse ./foo/\nuse ./bar\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	want := []string{"./foo/...", "./bar/..."}
+	if got := workspaceExtractPatterns(); !equalStrings(got, want) {
+		t.Errorf("workspaceExtractPatterns() = %v, want %v", got, want)
+	}
+}
+
+// mustMkModule writes a go.mod containing `contents` to a module directory named `dir`, relative
+// to the current directory.
+func mustMkModule(t *testing.T, dir, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
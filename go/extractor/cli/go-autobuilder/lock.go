@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lockFileName is the name of the lock file acquired in `srcdir` for the duration of
+// installDependenciesAndBuild.
+const lockFileName = ".codeql-go-autobuilder.lock"
+
+// forceLockReclaimVar lets operators force-reclaim a lock file left behind by a crashed prior
+// run, once they've confirmed it's safe to do so.
+const forceLockReclaimVar = "CODEQL_EXTRACTOR_GO_FORCE_RECLAIM_LOCK"
+
+// sourceLock represents an acquired exclusive lock on a source tree's lock file.
+type sourceLock struct {
+	path string
+	file *os.File
+}
+
+// acquireSourceLock acquires an exclusive lock on <srcdir>/.codeql-go-autobuilder.lock. Multiple
+// CodeQL extractions can be launched against the same checkout (matrix builds, retry logic, IDE
+// integrations), and without this lock moveToTemporaryGopath, tryUpdateGoModAndGoSum, and
+// restoreRepoLayout would race catastrophically if two processes interleave. If another live
+// process already holds the lock, this blocks until it's released.
+//
+// While a process holds the lock, the file records its PID; release clears that record before
+// unlocking. So if the file still names a PID, and that PID is no longer running, the lock was
+// never released cleanly - the recording process crashed while holding it - and since that can
+// mean the source tree is in a partially-moved state, we refuse to proceed unless
+// CODEQL_EXTRACTOR_GO_FORCE_RECLAIM_LOCK is set, so partial GOPATH moves don't silently poison
+// later builds. A file with no recorded PID (never locked, or cleanly released) carries no such
+// implication and is locked normally.
+func acquireSourceLock(srcdir string) *sourceLock {
+	path := filepath.Join(srcdir, lockFileName)
+
+	if pid, ok := readLockPID(path); ok && pid != os.Getpid() && !processAlive(pid) {
+		if os.Getenv(forceLockReclaimVar) == "" {
+			log.Fatalf(
+				"Lock file %s names process %d, which is no longer running and never cleared its "+
+					"lock record. This likely means a previous autobuilder invocation crashed, possibly "+
+					"leaving the source tree in a partially moved state. Refusing to proceed; inspect %s "+
+					"and, once you've confirmed it's safe, remove the lock file or set %s=true to "+
+					"force-reclaim it.\n",
+				path, pid, srcdir, forceLockReclaimVar)
+		}
+		log.Printf("Lock file %s names process %d, which is no longer running; %s is set, force-reclaiming it.\n",
+			path, pid, forceLockReclaimVar)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		log.Printf("Failed to open lock file %s: %s; continuing without a lock.\n", path, err.Error())
+		return nil
+	}
+
+	log.Printf("Acquiring lock on %s.\n", path)
+	if err := lockFile(f); err != nil {
+		log.Printf("Failed to acquire lock on %s: %s; continuing without a lock.\n", path, err.Error())
+		f.Close()
+		return nil
+	}
+
+	f.Truncate(0)
+	f.Seek(0, 0)
+	f.WriteString(strconv.Itoa(os.Getpid()))
+	f.Sync()
+
+	return &sourceLock{path: path, file: f}
+}
+
+// release clears the lock file's recorded PID and unlocks it. It is safe to call on a nil
+// *sourceLock, which is what acquireSourceLock returns when locking could not be set up at all.
+//
+// The lock file itself is deliberately left in place: removing it here would race a concurrent
+// process that has just opened the same path and is about to lock it (or already has) against a
+// new process creating a fresh file at that path and locking that instead, letting both believe
+// they hold the lock. cmd/go/internal/lockedfile, which this is modeled on, never deletes its
+// lock file for the same reason. The PID is cleared (rather than left in place) while the lock is
+// still held, so a later acquireSourceLock can tell this was a clean release rather than a crash.
+func (l *sourceLock) release() {
+	if l == nil {
+		return
+	}
+	l.file.Truncate(0)
+	l.file.Seek(0, 0)
+	l.file.Sync()
+	if err := unlockFile(l.file); err != nil {
+		log.Printf("Failed to release lock on %s: %s\n", l.path, err.Error())
+	}
+	l.file.Close()
+}
+
+// readLockPID reads the PID recorded in the lock file at `path`, if any.
+func readLockPID(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return pid, true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// TestAcquireReleaseReacquire guards against the regression where a clean release left the lock
+// file's PID in place, making the very next acquireSourceLock (in the same or a later process)
+// mistake a completely normal prior run for a crash and refuse to proceed.
+func TestAcquireReleaseReacquire(t *testing.T) {
+	dir := t.TempDir()
+
+	l1 := acquireSourceLock(dir)
+	if l1 == nil {
+		t.Fatal("acquireSourceLock() = nil on first acquisition")
+	}
+	l1.release()
+
+	l2 := acquireSourceLock(dir)
+	if l2 == nil {
+		t.Fatal("acquireSourceLock() = nil on second acquisition after a clean release")
+	}
+	l2.release()
+}
+
+func TestReleaseClearsLockPID(t *testing.T) {
+	dir := t.TempDir()
+
+	l := acquireSourceLock(dir)
+	if l == nil {
+		t.Fatal("acquireSourceLock() = nil")
+	}
+	path := filepath.Join(dir, lockFileName)
+
+	if _, ok := readLockPID(path); !ok {
+		t.Fatal("readLockPID() found no PID while the lock is held")
+	}
+
+	l.release()
+
+	if pid, ok := readLockPID(path); ok {
+		t.Errorf("readLockPID() = (%d, true) after a clean release, want ok=false", pid)
+	}
+}
+
+func TestAcquireSourceLockReclaimsAbandonedLock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, lockFileName)
+
+	// simulate a lock file left behind by a process that crashed while holding it: a PID that
+	// isn't running, and was never cleared by a clean release.
+	deadPID := findDeadPID(t)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(deadPID)), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	t.Setenv(forceLockReclaimVar, "true")
+
+	l := acquireSourceLock(dir)
+	if l == nil {
+		t.Fatal("acquireSourceLock() = nil when reclaiming an abandoned lock")
+	}
+	l.release()
+}
+
+// findDeadPID returns a PID that is very unlikely to name a running process.
+func findDeadPID(t *testing.T) int {
+	t.Helper()
+	for _, candidate := range []int{1<<31 - 1, 1 << 30, 999999} {
+		if !processAlive(candidate) {
+			return candidate
+		}
+	}
+	t.Fatal("could not find an unused PID to simulate a crashed process")
+	return 0
+}
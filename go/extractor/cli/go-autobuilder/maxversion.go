@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/github/codeql-go/extractor/util"
+)
+
+// maxGoVersionEnvVar lets callers pin the newest supported Go version directly, bypassing the
+// manifest and network lookups below. This is the primary escape hatch for air-gapped or
+// otherwise constrained environments.
+const maxGoVersionEnvVar = "CODEQL_EXTRACTOR_GO_MAX_VERSION"
+
+// maxGoVersionCacheVar names the directory a network-resolved version is cached under, so
+// repeated invocations don't have to re-fetch https://go.dev/dl/ every time.
+const maxGoVersionCacheVar = "CODEQL_EXTRACTOR_GO_CACHE"
+
+// maxGoVersionManifestName is the name of a manifest file shipped alongside the extractor binary
+// containing nothing but the newest Go version it's known to support, e.g. `1.22`. It's updated
+// with each extractor release so air-gapped environments get deterministic behavior without
+// needing network access.
+const maxGoVersionManifestName = "go-max-version.txt"
+
+// maxGoVersionCacheName is the file name a network-resolved version is cached under within
+// CODEQL_EXTRACTOR_GO_CACHE.
+const maxGoVersionCacheName = "go-max-version.txt"
+
+// defaultMaxGoVersion is the last-resort fallback used if the environment variable, manifest,
+// cache, and network lookup are all unavailable.
+const defaultMaxGoVersion = "1.20"
+
+// maxGoVersionCacheTTL bounds how long a network-resolved version is trusted before it's treated
+// as stale and re-fetched. Without this, a CI setup that persists CODEQL_EXTRACTOR_GO_CACHE
+// across runs would freeze the "dynamically discovered" version forever the first time it's
+// resolved, reintroducing the exact staleness problem this file exists to avoid.
+const maxGoVersionCacheTTL = 24 * time.Hour
+
+// httpClientTimeout bounds every network call in this file, so an unreachable go.dev (as in the
+// air-gapped environments this feature targets) fails fast into the manifest/default fallback
+// instead of hanging the build indefinitely.
+const httpClientTimeout = 10 * time.Second
+
+var maxVersionHTTPClient = &http.Client{Timeout: httpClientTimeout}
+
+// resolvedMaxGoVersion caches the result of resolveMaxGoVersion for the lifetime of the process.
+var resolvedMaxGoVersion = ""
+
+// resolveMaxGoVersion determines the newest Go version the extractor should treat as supported,
+// consulting, in order: CODEQL_EXTRACTOR_GO_MAX_VERSION, a manifest file shipped with the
+// extractor, a cached result from a previous run that's no older than maxGoVersionCacheTTL, and
+// finally the https://go.dev/dl/?mode=json index (whose result is then cached alongside the time
+// it was fetched). This means every new upstream Go release doesn't require a code change and a
+// re-release of the extractor just to stop emitting "outside supported range" diagnostics for
+// perfectly normal projects, while the TTL keeps a long-lived CI cache directory from pinning a
+// version forever. If none of these sources are available, it falls back to a hardcoded default
+// so behavior stays deterministic.
+func resolveMaxGoVersion() string {
+	if resolvedMaxGoVersion != "" {
+		return resolvedMaxGoVersion
+	}
+
+	if version := os.Getenv(maxGoVersionEnvVar); version != "" {
+		log.Printf("Using maximum supported Go version %s from %s\n", version, maxGoVersionEnvVar)
+		resolvedMaxGoVersion = version
+		return version
+	}
+
+	if version, ok := readMaxGoVersionManifest(); ok {
+		log.Printf("Using maximum supported Go version %s from bundled manifest\n", version)
+		resolvedMaxGoVersion = version
+		return version
+	}
+
+	cacheFile := maxGoVersionCacheFile()
+	if cacheFile != "" {
+		if version, ok := readMaxGoVersionCache(cacheFile); ok {
+			log.Printf("Using maximum supported Go version %s from cache\n", version)
+			resolvedMaxGoVersion = version
+			return version
+		}
+	}
+
+	if version, ok := fetchMaxGoVersionFromNetwork(); ok {
+		log.Printf("Using maximum supported Go version %s from https://go.dev/dl/\n", version)
+		if cacheFile != "" {
+			if err := writeMaxGoVersionCache(cacheFile, version); err != nil {
+				log.Printf("Failed to cache maximum supported Go version: %s\n", err.Error())
+			}
+		}
+		resolvedMaxGoVersion = version
+		return version
+	}
+
+	log.Printf("Could not determine the maximum supported Go version; falling back to %s\n", defaultMaxGoVersion)
+	resolvedMaxGoVersion = defaultMaxGoVersion
+	return defaultMaxGoVersion
+}
+
+// readMaxGoVersionManifest reads the manifest file shipped alongside the extractor binary.
+func readMaxGoVersionManifest() (string, bool) {
+	extractor, err := util.GetExtractorPath()
+	if err != nil {
+		return "", false
+	}
+	return readMaxGoVersionFile(filepath.Join(filepath.Dir(extractor), maxGoVersionManifestName))
+}
+
+// readMaxGoVersionFile reads and trims a file expected to contain nothing but a Go version.
+func readMaxGoVersionFile(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	version := strings.TrimSpace(string(data))
+	if version == "" || !semver.IsValid("v"+version) {
+		return "", false
+	}
+	return version, true
+}
+
+// readMaxGoVersionCache reads a cache file written by writeMaxGoVersionCache, reporting found=false
+// if it's missing, malformed, or older than maxGoVersionCacheTTL.
+func readMaxGoVersionCache(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	lines := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)
+	if len(lines) != 2 {
+		return "", false
+	}
+
+	version := strings.TrimSpace(lines[0])
+	if version == "" || !semver.IsValid("v"+version) {
+		return "", false
+	}
+
+	cachedAt, err := strconv.ParseInt(strings.TrimSpace(lines[1]), 10, 64)
+	if err != nil {
+		return "", false
+	}
+	if time.Since(time.Unix(cachedAt, 0)) > maxGoVersionCacheTTL {
+		return "", false
+	}
+
+	return version, true
+}
+
+// writeMaxGoVersionCache writes `version`, alongside the current time, to the cache file at
+// `path`, so a later readMaxGoVersionCache call can tell how stale it is.
+func writeMaxGoVersionCache(path, version string) error {
+	contents := version + "\n" + strconv.FormatInt(time.Now().Unix(), 10) + "\n"
+	return os.WriteFile(path, []byte(contents), 0644)
+}
+
+// maxGoVersionCacheFile returns the path a network-resolved version is cached at, or "" if
+// CODEQL_EXTRACTOR_GO_CACHE is not set.
+func maxGoVersionCacheFile() string {
+	cacheDir := os.Getenv(maxGoVersionCacheVar)
+	if cacheDir == "" {
+		return ""
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		log.Printf("Failed to create %s: %s\n", cacheDir, err.Error())
+		return ""
+	}
+	return filepath.Join(cacheDir, maxGoVersionCacheName)
+}
+
+// goDLRelease describes one release in the https://go.dev/dl/?mode=json index; we only need the
+// version and whether it's stable.
+type goDLRelease struct {
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+}
+
+// fetchMaxGoVersionFromNetwork consults https://go.dev/dl/?mode=json for the newest stable
+// release and returns its version in `X.Y` form.
+func fetchMaxGoVersionFromNetwork() (string, bool) {
+	resp, err := maxVersionHTTPClient.Get("https://go.dev/dl/?mode=json")
+	if err != nil {
+		log.Printf("Failed to fetch the Go download index: %s\n", err.Error())
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	var releases []goDLRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		log.Printf("Failed to parse the Go download index: %s\n", err.Error())
+		return "", false
+	}
+
+	best := ""
+	for _, r := range releases {
+		if !r.Stable || !strings.HasPrefix(r.Version, "go") {
+			continue
+		}
+		short := semver.MajorMinor("v" + strings.TrimPrefix(r.Version, "go"))
+		if short == "" {
+			continue
+		}
+		version := strings.TrimPrefix(short, "v")
+		if best == "" || semver.Compare("v"+version, "v"+best) > 0 {
+			best = version
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return best, true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadMaxGoVersionFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		contents    string
+		missing     bool
+		wantVersion string
+		wantOK      bool
+	}{
+		{"missing file", "", true, "", false},
+		{"valid version", "1.22\n", false, "1.22", true},
+		{"valid version with surrounding whitespace", "  1.22  \n", false, "1.22", true},
+		{"empty file", "", false, "", false},
+		{"not a version", "not-a-version\n", false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".txt")
+			if !tt.missing {
+				if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+					t.Fatalf("WriteFile: %s", err)
+				}
+			}
+
+			version, ok := readMaxGoVersionFile(path)
+			if ok != tt.wantOK || version != tt.wantVersion {
+				t.Errorf("readMaxGoVersionFile() = (%q, %v), want (%q, %v)", version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMaxGoVersionCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go-max-version.txt")
+
+	if err := writeMaxGoVersionCache(path, "1.23"); err != nil {
+		t.Fatalf("writeMaxGoVersionCache: %s", err)
+	}
+
+	version, ok := readMaxGoVersionCache(path)
+	if !ok || version != "1.23" {
+		t.Errorf("readMaxGoVersionCache() = (%q, %v), want (%q, true)", version, ok, "1.23")
+	}
+}
+
+func TestMaxGoVersionCacheExpiry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go-max-version.txt")
+
+	stale := time.Now().Add(-2 * maxGoVersionCacheTTL).Unix()
+	contents := "1.23\n" + strconv.FormatInt(stale, 10) + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if _, ok := readMaxGoVersionCache(path); ok {
+		t.Error("readMaxGoVersionCache() ok = true for an entry older than the TTL, want false")
+	}
+}
+
+func TestMaxGoVersionCacheMalformed(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"missing timestamp", "1.23\n"},
+		{"non-numeric timestamp", "1.23\nnot-a-time\n"},
+		{"not a version", "not-a-version\n1700000000\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".txt")
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+			if _, ok := readMaxGoVersionCache(path); ok {
+				t.Errorf("readMaxGoVersionCache(%q) ok = true, want false", tt.contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// goOverlay mirrors the JSON schema accepted by `go build -overlay` (see
+// cmd/go/internal/fsys): a map from the logical path of a file, as the go command sees it, to the
+// real, on-disk path whose content should be substituted for it.
+type goOverlay struct {
+	Replace map[string]string `json:"Replace"`
+}
+
+// tryReadOverlay reads the overlay file named by CODEQL_EXTRACTOR_GO_OVERLAY, if set, returning
+// its path and parsed contents.
+func tryReadOverlay() (string, goOverlay, bool) {
+	path := os.Getenv("CODEQL_EXTRACTOR_GO_OVERLAY")
+	if path == "" {
+		return "", goOverlay{}, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read overlay file %s: %s\n", path, err.Error())
+		return "", goOverlay{}, false
+	}
+
+	var overlay goOverlay
+	if err := json.Unmarshal(data, &overlay); err != nil {
+		log.Printf("Failed to parse overlay file %s: %s\n", path, err.Error())
+		return "", goOverlay{}, false
+	}
+
+	return path, overlay, true
+}
+
+// overlayArgs returns the `-overlay=<path>` argument to pass to `go list`/`go build` and to the
+// extractor binary, if CODEQL_EXTRACTOR_GO_OVERLAY names a valid overlay file, or nil otherwise.
+func overlayArgs() []string {
+	path, _, found := tryReadOverlay()
+	if !found {
+		return nil
+	}
+	return []string{"-overlay=" + path}
+}
+
+// configurePathTransformerForOverlay sets SEMMLE_PATH_TRANSFORMER so that the real, on-disk
+// location of overlaid files (e.g. a generated protobuf/mockgen/wire file) is rewritten back to
+// the logical path the overlay replaces, keeping the source archive and snapshot consistent with
+// the original, unvirtualized source tree.
+//
+// srcarchive's project layout parser only understands a single rewrite section of the form
+// "#<to>\n<from>//\n" and rejects a second one outright, so this only applies when every overlay
+// replacement shares one common logical-path prefix and one common real-path prefix - the layout
+// produced by code generators that mirror the source tree under a single output directory - and
+// is a no-op otherwise. It also refuses to clobber an existing SEMMLE_PATH_TRANSFORMER, since
+// there is no way to express two rewrites in one section.
+func configurePathTransformerForOverlay() {
+	_, overlay, found := tryReadOverlay()
+	if !found || len(overlay.Replace) == 0 {
+		return
+	}
+
+	if os.Getenv("SEMMLE_PATH_TRANSFORMER") != "" {
+		log.Println("SEMMLE_PATH_TRANSFORMER is already set; not overriding it to rewrite the overlay's virtual paths.")
+		return
+	}
+
+	logicalPrefix, realPrefix, ok := commonOverlayPrefixes(overlay)
+	if !ok {
+		log.Println("Overlay replacements don't share a common path prefix; cannot rewrite them to their logical originals with a single SEMMLE_PATH_TRANSFORMER section.")
+		return
+	}
+
+	pt, err := os.CreateTemp("", "overlay-path-transformer")
+	if err != nil {
+		log.Printf("Unable to create overlay path transformer file: %s\n", err.Error())
+		return
+	}
+	defer pt.Close()
+
+	if _, err := fmt.Fprintf(pt, "#%s\n%s//\n", logicalPrefix, realPrefix); err != nil {
+		log.Printf("Unable to write overlay path transformer: %s\n", err.Error())
+		return
+	}
+
+	if err := os.Setenv("SEMMLE_PATH_TRANSFORMER", pt.Name()); err != nil {
+		log.Printf("Unable to set SEMMLE_PATH_TRANSFORMER environment variable: %s\n", err.Error())
+	}
+}
+
+// commonOverlayPrefixes returns the longest common directory prefix of every overlay
+// replacement's logical path, and of every replacement's real path, together with whether
+// overlay.Replace can be expressed as that single (logicalPrefix -> realPrefix) rewrite - i.e.
+// every entry is of the form logicalPrefix+suffix -> realPrefix+suffix for the same suffix.
+func commonOverlayPrefixes(overlay goOverlay) (logicalPrefix, realPrefix string, ok bool) {
+	logicalPaths := make([]string, 0, len(overlay.Replace))
+	realPaths := make([]string, 0, len(overlay.Replace))
+	for logicalPath, realPath := range overlay.Replace {
+		logicalPaths = append(logicalPaths, logicalPath)
+		realPaths = append(realPaths, realPath)
+	}
+
+	logicalPrefix = longestCommonDirPrefix(logicalPaths)
+	realPrefix = longestCommonDirPrefix(realPaths)
+
+	for logicalPath, realPath := range overlay.Replace {
+		if !strings.HasPrefix(logicalPath, logicalPrefix) || !strings.HasPrefix(realPath, realPrefix) {
+			return "", "", false
+		}
+		if strings.TrimPrefix(logicalPath, logicalPrefix) != strings.TrimPrefix(realPath, realPrefix) {
+			return "", "", false
+		}
+	}
+
+	return logicalPrefix, realPrefix, true
+}
+
+// longestCommonDirPrefix returns the longest common prefix of `paths`, trimmed back to the
+// preceding "/" so the result always names whole directory components.
+func longestCommonDirPrefix(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	prefix := paths[0]
+	for _, p := range paths[1:] {
+		n := len(prefix)
+		if len(p) < n {
+			n = len(p)
+		}
+		i := 0
+		for i < n && prefix[i] == p[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+
+	if idx := strings.LastIndex(prefix, "/"); idx >= 0 {
+		return prefix[:idx+1]
+	}
+	return ""
+}
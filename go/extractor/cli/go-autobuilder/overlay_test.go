@@ -0,0 +1,108 @@
+package main
+
+import "testing"
+
+func TestLongestCommonDirPrefix(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"no paths", nil, ""},
+		{"single path", []string{"/repo/gen/foo.pb.go"}, "/repo/gen/"},
+		{"single path with no directory", []string{"foo.go"}, ""},
+		{
+			"multiple paths under one directory",
+			[]string{"/repo/gen/foo.pb.go", "/repo/gen/bar.pb.go"},
+			"/repo/gen/",
+		},
+		{
+			"multiple paths under nested directories",
+			[]string{"/repo/gen/pb/foo.pb.go", "/repo/gen/pb/sub/bar.pb.go"},
+			"/repo/gen/pb/",
+		},
+		{
+			"paths with no common directory beyond the root",
+			[]string{"/repo/gen/foo.pb.go", "/other/bar.pb.go"},
+			"/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := longestCommonDirPrefix(tt.paths); got != tt.want {
+				t.Errorf("longestCommonDirPrefix(%v) = %q, want %q", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommonOverlayPrefixes(t *testing.T) {
+	tests := []struct {
+		name        string
+		replace     map[string]string
+		wantLogical string
+		wantReal    string
+		wantOK      bool
+	}{
+		{
+			name: "single file",
+			replace: map[string]string{
+				"/repo/gen/foo.pb.go": "/tmp/overlay/gen/foo.pb.go",
+			},
+			wantLogical: "/repo/gen/",
+			wantReal:    "/tmp/overlay/gen/",
+			wantOK:      true,
+		},
+		{
+			name: "multiple files under one directory",
+			replace: map[string]string{
+				"/repo/gen/foo.pb.go": "/tmp/overlay/gen/foo.pb.go",
+				"/repo/gen/bar.pb.go": "/tmp/overlay/gen/bar.pb.go",
+			},
+			wantLogical: "/repo/gen/",
+			wantReal:    "/tmp/overlay/gen/",
+			wantOK:      true,
+		},
+		{
+			name: "multiple files under nested subdirectories",
+			replace: map[string]string{
+				"/repo/gen/a/foo.pb.go": "/tmp/overlay/gen/a/foo.pb.go",
+				"/repo/gen/b/bar.pb.go": "/tmp/overlay/gen/b/bar.pb.go",
+			},
+			wantLogical: "/repo/gen/",
+			wantReal:    "/tmp/overlay/gen/",
+			wantOK:      true,
+		},
+		{
+			name: "prefixes share a directory but suffixes don't match",
+			replace: map[string]string{
+				"/repo/gen/foo.pb.go": "/tmp/overlay/gen/foo_gen.go",
+			},
+			wantOK: false,
+		},
+		{
+			name: "one entry's suffix matches but another's doesn't",
+			replace: map[string]string{
+				"/repo/gen/foo.pb.go": "/tmp/overlay/gen/foo.pb.go",
+				"/repo/gen/bar.pb.go": "/tmp/overlay/gen/bar_gen.go",
+			},
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logical, real, ok := commonOverlayPrefixes(goOverlay{Replace: tt.replace})
+			if ok != tt.wantOK {
+				t.Fatalf("commonOverlayPrefixes() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if logical != tt.wantLogical || real != tt.wantReal {
+				t.Errorf("commonOverlayPrefixes() = (%q, %q), want (%q, %q)", logical, real, tt.wantLogical, tt.wantReal)
+			}
+		})
+	}
+}
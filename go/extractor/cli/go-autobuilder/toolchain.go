@@ -0,0 +1,367 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/github/codeql-go/extractor/util"
+)
+
+// toolchainDirectiveRe matches a `toolchain go1.22.3` directive line, which go.mod and go.work
+// files may carry since Go 1.21.
+var toolchainDirectiveRe = regexp.MustCompile(`(?m)^toolchain[ \t]+go([0-9]+\.[0-9]+(?:\.[0-9]+)?)$`)
+
+// toolchainDisableDownloadVar is the escape hatch for air-gapped environments that cannot reach
+// https://go.dev/dl/ to provision a pinned toolchain.
+const toolchainDisableDownloadVar = "CODEQL_EXTRACTOR_GO_DISABLE_TOOLCHAIN_DOWNLOAD"
+
+// toolchainIndexHTTPTimeout bounds the https://go.dev/dl/?mode=json index lookup, so an
+// unreachable go.dev fails fast rather than hanging the build indefinitely in an air-gapped
+// environment.
+const toolchainIndexHTTPTimeout = 30 * time.Second
+
+// toolchainDownloadHTTPTimeout bounds downloading a toolchain archive itself; this is much more
+// generous than the index lookup since the archive is tens of megabytes.
+const toolchainDownloadHTTPTimeout = 5 * time.Minute
+
+var toolchainIndexHTTPClient = &http.Client{Timeout: toolchainIndexHTTPTimeout}
+var toolchainDownloadHTTPClient = &http.Client{Timeout: toolchainDownloadHTTPTimeout}
+
+// tryReadToolchainDirective looks for a `toolchain goX.Y.Z` directive in `go.mod` (or, in
+// workspace mode, in `go.work` and every workspace module's `go.mod`), returning the pinned
+// version and whether one was found.
+func tryReadToolchainDirective(depMode DependencyInstallerMode) (string, bool) {
+	if depMode == GoWorkspace {
+		best, found := "", false
+		if data, err := os.ReadFile("go.work"); err == nil {
+			if m := toolchainDirectiveRe.FindSubmatch(data); m != nil {
+				best, found = string(m[1]), true
+			}
+		}
+		if w, ok := tryReadGoWork(); ok {
+			for _, modDir := range w.modules {
+				data, err := os.ReadFile(filepath.Join(modDir, "go.mod"))
+				if err != nil {
+					continue
+				}
+				if m := toolchainDirectiveRe.FindSubmatch(data); m != nil {
+					version := string(m[1])
+					if !found || semver.Compare("v"+version, "v"+best) > 0 {
+						best, found = version, true
+					}
+				}
+			}
+		}
+		return best, found
+	}
+	if depMode == GoGetWithModules {
+		data, err := os.ReadFile("go.mod")
+		if err != nil {
+			return "", false
+		}
+		if m := toolchainDirectiveRe.FindSubmatch(data); m != nil {
+			return string(m[1]), true
+		}
+	}
+	return "", false
+}
+
+// ensureToolchain checks whether `go.mod`/`go.work` pins a toolchain newer than the one on PATH,
+// and if so downloads it, unpacks it under SEMMLE_CACHE (or a tempdir), and re-execs the
+// autobuilder with that toolchain's `go` binary placed first on PATH. Returns false, without
+// re-executing, if no newer toolchain is required or toolchain downloads have been disabled.
+func ensureToolchain(depMode DependencyInstallerMode) bool {
+	toolchainVersion, found := tryReadToolchainDirective(depMode)
+	if !found {
+		return false
+	}
+	if os.Getenv(toolchainDisableDownloadVar) != "" {
+		log.Printf("toolchain go%s is requested, but %s is set; not downloading it\n", toolchainVersion, toolchainDisableDownloadVar)
+		return false
+	}
+	if semver.Compare("v"+toolchainVersion, getEnvGoSemVer()) <= 0 {
+		// the ambient toolchain already satisfies the pinned version
+		return false
+	}
+
+	goBin, err := downloadGoToolchain(toolchainVersion)
+	if err != nil {
+		log.Printf("Failed to provision toolchain go%s: %s\n", toolchainVersion, err.Error())
+		return false
+	}
+
+	log.Printf("Re-executing the autobuilder with toolchain go%s (%s) on PATH\n", toolchainVersion, goBin)
+	return reexecWithGo(filepath.Dir(goBin))
+}
+
+// goToolchainCacheDir returns the directory toolchain archives are unpacked into: a
+// `go/toolchain` folder under SEMMLE_CACHE if set, otherwise a temporary directory.
+func goToolchainCacheDir() (string, error) {
+	if cacheDir := os.Getenv("SEMMLE_CACHE"); cacheDir != "" {
+		dir := filepath.Join(cacheDir, "go", "toolchain")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+	return os.MkdirTemp("", "go-toolchain")
+}
+
+// goDownloadIndexEntry describes one release in the https://go.dev/dl/?mode=json index.
+type goDownloadIndexEntry struct {
+	Version string `json:"version"`
+	Files   []struct {
+		Filename string `json:"filename"`
+		SHA256   string `json:"sha256"`
+	} `json:"files"`
+}
+
+// downloadGoToolchain downloads and unpacks the `go1.X.Y.<goos>-<goarch>` archive for `version`
+// from https://go.dev/dl/, verifying its published SHA256 sum, and returns the path to the `go`
+// binary inside the unpacked tree.
+func downloadGoToolchain(version string) (string, error) {
+	cacheDir, err := goToolchainCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to create toolchain cache directory: %w", err)
+	}
+
+	ext := "tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = "zip"
+	}
+	archiveName := fmt.Sprintf("go%s.%s-%s.%s", version, runtime.GOOS, runtime.GOARCH, ext)
+	installDir := filepath.Join(cacheDir, "go"+version)
+	goBinName := "go"
+	if runtime.GOOS == "windows" {
+		goBinName = "go.exe"
+	}
+	goBin := filepath.Join(installDir, "go", "bin", goBinName)
+
+	if util.FileExists(goBin) {
+		log.Printf("toolchain go%s is already provisioned at %s\n", version, goBin)
+		return goBin, nil
+	}
+
+	sha256sum, err := lookUpToolchainSHA256(archiveName)
+	if err != nil {
+		return "", err
+	}
+
+	archivePath := filepath.Join(cacheDir, archiveName)
+	if err := downloadFile("https://go.dev/dl/"+archiveName, archivePath); err != nil {
+		return "", err
+	}
+	defer os.Remove(archivePath)
+
+	if err := verifySHA256(archivePath, sha256sum); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(installDir, 0755); err != nil {
+		return "", err
+	}
+	if err := extractArchive(archivePath, installDir); err != nil {
+		return "", err
+	}
+
+	return goBin, nil
+}
+
+// lookUpToolchainSHA256 consults the https://go.dev/dl/?mode=json index for the published
+// SHA256 sum of `archiveName`.
+func lookUpToolchainSHA256(archiveName string) (string, error) {
+	resp, err := toolchainIndexHTTPClient.Get("https://go.dev/dl/?mode=json&include=all")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch the Go download index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var entries []goDownloadIndexEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return "", fmt.Errorf("failed to parse the Go download index: %w", err)
+	}
+
+	for _, entry := range entries {
+		for _, f := range entry.Files {
+			if f.Filename == archiveName {
+				return f.SHA256, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find %s in the Go download index", archiveName)
+}
+
+// downloadFile downloads `url` to `dest`.
+func downloadFile(url, dest string) error {
+	resp, err := toolchainDownloadHTTPClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// verifySHA256 checks that the contents of `path` hash to `expected`, failing closed if they
+// don't match so a corrupted or tampered-with download is never unpacked.
+func verifySHA256(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("SHA256 mismatch for %s: expected %s, got %s", path, expected, actual)
+	}
+	return nil
+}
+
+// extractArchive unpacks the `.tar.gz` or `.zip` archive at `path` into `destDir`.
+func extractArchive(path, destDir string) error {
+	if filepath.Ext(path) == ".zip" {
+		return extractZip(path, destDir)
+	}
+	return extractTarGz(path, destDir)
+}
+
+func extractTarGz(path, destDir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destDir, hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			out.Close()
+		}
+	}
+}
+
+func extractZip(path, destDir string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		target := filepath.Join(destDir, f.Name)
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		in, err := f.Open()
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
+		if err != nil {
+			in.Close()
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reexecWithGo re-invokes the current process with `binDir` prepended to PATH, so that a
+// newly-provisioned `go` binary takes precedence over whatever is already on PATH. It does not
+// return if re-exec succeeds, since the current process exits with the child's exit code.
+func reexecWithGo(binDir string) bool {
+	self, err := os.Executable()
+	if err != nil {
+		log.Printf("Failed to determine the path of the running executable: %s\n", err.Error())
+		return false
+	}
+
+	newPath := binDir + string(os.PathListSeparator) + os.Getenv("PATH")
+
+	cmd := exec.Command(self, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PATH="+newPath)
+
+	runErr := cmd.Run()
+	exitCode := 0
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if runErr != nil {
+		log.Printf("Failed to re-exec autobuilder with provisioned toolchain: %s\n", runErr.Error())
+		return false
+	}
+	os.Exit(exitCode)
+	return true // unreachable
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestToolchainDirectiveRe(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantVersion string
+		wantMatch   bool
+	}{
+		{"no directive", "go 1.21\n", "", false},
+		{"patch version", "toolchain go1.22.3\n", "1.22.3", true},
+		{"no patch version", "toolchain go1.22\n", "1.22", true},
+		{"trailing whitespace is not allowed", "toolchain go1.22 \n", "", false},
+		{"not anchored to start of line", "  toolchain go1.22\n", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := toolchainDirectiveRe.FindStringSubmatch(tt.line)
+			if tt.wantMatch && (m == nil || m[1] != tt.wantVersion) {
+				t.Errorf("toolchainDirectiveRe.FindStringSubmatch(%q) = %v, want version %q", tt.line, m, tt.wantVersion)
+			}
+			if !tt.wantMatch && m != nil {
+				t.Errorf("toolchainDirectiveRe.FindStringSubmatch(%q) = %v, want no match", tt.line, m)
+			}
+		})
+	}
+}
+
+func TestTryReadToolchainDirectiveModules(t *testing.T) {
+	withWorkdir(t)
+
+	if err := os.WriteFile("go.mod", []byte("module example.com/foo\n\ngo 1.20\ntoolchain go1.22.3\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	version, found := tryReadToolchainDirective(GoGetWithModules)
+	if !found || version != "1.22.3" {
+		t.Errorf("tryReadToolchainDirective(GoGetWithModules) = (%q, %v), want (%q, true)", version, found, "1.22.3")
+	}
+}
+
+func TestTryReadToolchainDirectiveNoDirective(t *testing.T) {
+	withWorkdir(t)
+
+	if err := os.WriteFile("go.mod", []byte("module example.com/foo\n\ngo 1.20\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if _, found := tryReadToolchainDirective(GoGetWithModules); found {
+		t.Error("tryReadToolchainDirective(GoGetWithModules) found = true, want false")
+	}
+}
+
+func TestTryReadToolchainDirectiveWorkspace(t *testing.T) {
+	withWorkdir(t)
+
+	mustMkModule(t, "foo", "module example.com/foo\n\ngo 1.20\ntoolchain go1.21.0\n")
+	mustMkModule(t, "bar", "module example.com/bar\n\ngo 1.20\ntoolchain go1.22.5\n")
+	if err := os.WriteFile("go.work", []byte("go 1.21\n\nuse ./foo\nuse ./bar\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	version, found := tryReadToolchainDirective(GoWorkspace)
+	if !found || version != "1.22.5" {
+		t.Errorf("tryReadToolchainDirective(GoWorkspace) = (%q, %v), want (%q, true)", version, found, "1.22.5")
+	}
+}
@@ -0,0 +1,51 @@
+// Package goversion computes the effective Go language version for a single source file: the
+// maximum of the module/workspace `go` directive and any `//go:build goX.Y` constraint that
+// applies to the file itself or its enclosing package.
+//
+// Note: wiring the result of this computation into go/types.Config's per-file
+// Info.FileVersions, and emitting it as a TRAP attribute, is done by the type-checking driver
+// elsewhere in the extractor, which is not part of this snapshot of the repository. This package
+// only provides the self-contained parsing and version-resolution logic.
+package goversion
+
+import (
+	"regexp"
+
+	"golang.org/x/mod/semver"
+)
+
+// buildTagGoVersionRe matches the `goX.Y` token inside a `//go:build` constraint expression.
+var buildTagGoVersionRe = regexp.MustCompile(`\bgo([0-9]+\.[0-9]+)\b`)
+
+// ParseBuildTagVersion extracts the highest `goX.Y` version named in a `//go:build` constraint
+// line, if any. A constraint that names no Go version reports found=false so callers can fall
+// back to the module version; malformed constraints are likewise treated as "no opinion" rather
+// than an error, since this only looks for version tokens and doesn't evaluate the boolean build
+// expression itself.
+func ParseBuildTagVersion(buildTagLine string) (version string, found bool) {
+	for _, m := range buildTagGoVersionRe.FindAllStringSubmatch(buildTagLine, -1) {
+		v := m[1]
+		if !found || semver.Compare("v"+v, "v"+version) > 0 {
+			version, found = v, true
+		}
+	}
+	return version, found
+}
+
+// EffectiveFileVersion returns the Go language version a file should be type-checked against:
+// the maximum of the module/workspace `go` directive, the file's own `//go:build goX.Y`
+// constraint, and its enclosing package's `//go:build goX.Y` constraint.
+func EffectiveFileVersion(moduleVersion string, fileBuildTags, packageBuildTags []string) string {
+	best := moduleVersion
+	for _, line := range fileBuildTags {
+		if v, found := ParseBuildTagVersion(line); found && semver.Compare("v"+v, "v"+best) > 0 {
+			best = v
+		}
+	}
+	for _, line := range packageBuildTags {
+		if v, found := ParseBuildTagVersion(line); found && semver.Compare("v"+v, "v"+best) > 0 {
+			best = v
+		}
+	}
+	return best
+}
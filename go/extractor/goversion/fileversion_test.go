@@ -0,0 +1,72 @@
+package goversion
+
+import "testing"
+
+func TestParseBuildTagVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantVersion string
+		wantFound   bool
+	}{
+		{"no build tag", "", "", false},
+		{"unrelated build tag", "//go:build linux && amd64", "", false},
+		{"single version", "//go:build go1.21", "1.21", true},
+		{"version among other constraints", "//go:build go1.18 && !windows", "1.18", true},
+		{"picks the highest of several versions", "//go:build go1.18 || go1.21", "1.21", true},
+		{"picks the highest regardless of order", "//go:build go1.21 || go1.18", "1.21", true},
+		{"malformed constraint is treated as no opinion", "//go:build go", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, found := ParseBuildTagVersion(tt.line)
+			if version != tt.wantVersion || found != tt.wantFound {
+				t.Errorf("ParseBuildTagVersion(%q) = (%q, %v), want (%q, %v)",
+					tt.line, version, found, tt.wantVersion, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestEffectiveFileVersion(t *testing.T) {
+	tests := []struct {
+		name             string
+		moduleVersion    string
+		fileBuildTags    []string
+		packageBuildTags []string
+		want             string
+	}{
+		{"no build tags falls back to module version", "1.20", nil, nil, "1.20"},
+		{
+			"file build tag above module version wins",
+			"1.18", []string{"//go:build go1.21"}, nil,
+			"1.21",
+		},
+		{
+			"package build tag above module version wins",
+			"1.18", nil, []string{"//go:build go1.21"},
+			"1.21",
+		},
+		{
+			"module version above both build tags wins",
+			"1.22", []string{"//go:build go1.18"}, []string{"//go:build go1.19"},
+			"1.22",
+		},
+		{
+			"highest of module, file, and package versions wins",
+			"1.18", []string{"//go:build go1.20"}, []string{"//go:build go1.21"},
+			"1.21",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EffectiveFileVersion(tt.moduleVersion, tt.fileBuildTags, tt.packageBuildTags)
+			if got != tt.want {
+				t.Errorf("EffectiveFileVersion(%q, %v, %v) = %q, want %q",
+					tt.moduleVersion, tt.fileBuildTags, tt.packageBuildTags, got, tt.want)
+			}
+		})
+	}
+}